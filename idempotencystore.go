@@ -0,0 +1,161 @@
+package gocsi
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/net/context"
+)
+
+// IdempotencyStore is implemented by types that can durably persist the
+// idempotent interceptor's per-volume operation state -- namely, which
+// RPCs are currently known to be in error for a given volume name or ID --
+// so that state survives a plugin restart instead of living only in an
+// in-memory map. This mirrors the MetadataStore/util.CachePersister
+// pattern the CSI reference plugins (e.g. ceph-csi) use to persist their
+// own state across restarts.
+type IdempotencyStore interface {
+	// Get returns the value stored for key, or a nil value if key does
+	// not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Put stores val under key, overwriting any existing value.
+	Put(ctx context.Context, key string, val []byte) error
+
+	// Delete removes key. It is not an error if key does not exist.
+	Delete(ctx context.Context, key string) error
+
+	// List returns the keys that begin with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// memIdempotencyStore is a non-durable, in-memory IdempotencyStore. It is the
+// default used when an idempotent interceptor is not configured with
+// WithIdempotencyStore, preserving the original, restart-does-not-survive
+// behavior.
+type memIdempotencyStore struct {
+	l sync.Mutex
+	m map[string][]byte
+}
+
+// NewMemIdempotencyStore returns a new, empty, in-memory IdempotencyStore.
+func NewMemIdempotencyStore() IdempotencyStore {
+	return &memIdempotencyStore{m: map[string][]byte{}}
+}
+
+func (s *memIdempotencyStore) Get(
+	ctx context.Context, key string) ([]byte, error) {
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.m[key], nil
+}
+
+func (s *memIdempotencyStore) Put(
+	ctx context.Context, key string, val []byte) error {
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.m[key] = val
+	return nil
+}
+
+func (s *memIdempotencyStore) Delete(ctx context.Context, key string) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+func (s *memIdempotencyStore) List(
+	ctx context.Context, prefix string) ([]string, error) {
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	var keys []string
+	for k := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// boltIdempotencyStoreBucket is the sole BoltDB bucket used to store
+// idempotent interceptor state.
+var boltIdempotencyStoreBucket = []byte("gocsi.idempotency")
+
+// boltIdempotencyStore is an IdempotencyStore backed by a BoltDB file,
+// allowing a plugin running as a Kubernetes sidecar to survive pod
+// restarts without losing track of recently-failed operations.
+// Operations that are in flight when the process stops are not
+// recorded.
+//
+// github.com/boltdb/bolt is a new dependency this file introduces; this
+// tree has no go.mod/vendor manifest to record it in, so it isn't
+// pinned anywhere but here.
+type boltIdempotencyStore struct {
+	db *bolt.DB
+}
+
+// NewBoltIdempotencyStore returns an IdempotencyStore backed by the
+// BoltDB file at path, creating it if it does not already exist.
+func NewBoltIdempotencyStore(path string) (IdempotencyStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltIdempotencyStoreBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltIdempotencyStore{db: db}, nil
+}
+
+func (s *boltIdempotencyStore) Get(
+	ctx context.Context, key string) ([]byte, error) {
+
+	var val []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltIdempotencyStoreBucket).Get([]byte(key)); v != nil {
+			val = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return val, err
+}
+
+func (s *boltIdempotencyStore) Put(
+	ctx context.Context, key string, val []byte) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltIdempotencyStoreBucket).Put([]byte(key), val)
+	})
+}
+
+func (s *boltIdempotencyStore) Delete(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltIdempotencyStoreBucket).Delete([]byte(key))
+	})
+}
+
+func (s *boltIdempotencyStore) List(
+	ctx context.Context, prefix string) ([]string, error) {
+
+	var keys []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltIdempotencyStoreBucket).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -1,12 +1,15 @@
 package gocsi
 
 import (
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/thecodeteam/gocsi/csi"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"golang.org/x/net/context"
 )
@@ -38,24 +41,121 @@ type IdempotencyProvider interface {
 		id string,
 		pubVolInfo map[string]string,
 		targetPath string) (bool, error)
+
+	// GetSnapshotID should return the ID of the snapshot specified
+	// by the provided snapshot name. If the snapshot does not exist then
+	// an empty string should be returned.
+	GetSnapshotID(ctx context.Context, name string) (string, error)
+
+	// GetSnapshotInfo should return information about the snapshot
+	// specified by the provided snapshot ID or name. If the snapshot does
+	// not exist then a nil value should be returned.
+	GetSnapshotInfo(ctx context.Context, id, name string) (*csi.SnapshotInfo, error)
+
+	// GetVolumeSize should return the current capacity, in bytes, of
+	// the volume specified by the provided volume ID.
+	GetVolumeSize(ctx context.Context, id string) (int64, error)
+
+	// CompareVolume should return nil if existing -- a volume found to
+	// already have the name requested in req -- is compatible with req
+	// (same capacity range, capabilities, parameters, and content
+	// source), meaning req is truly a retry of whatever created
+	// existing. It should return a non-nil error describing the
+	// mismatch if req asks for a volume that is incompatible with
+	// existing, so CreateVolume can fail with VOLUME_ALREADY_EXISTS
+	// instead of silently returning existing.
+	CompareVolume(
+		ctx context.Context,
+		existing *csi.VolumeInfo,
+		req *csi.CreateVolumeRequest) error
+
+	// ComparePublishedVolume should return nil if the volume's existing
+	// publication on the node, described by pubInfo, is compatible with
+	// req (same readonly flag and access mode). It should return a
+	// non-nil error describing the mismatch otherwise.
+	ComparePublishedVolume(
+		ctx context.Context,
+		pubInfo map[string]string,
+		req *csi.ControllerPublishVolumeRequest) error
+
+	// CompareNodePublishedVolume should return nil if the volume
+	// specified by id, already published at req's target path on this
+	// node, is compatible with req (same target path, fs type, and
+	// mount flags). It should return a non-nil error describing the
+	// mismatch otherwise.
+	CompareNodePublishedVolume(
+		ctx context.Context,
+		id string,
+		req *csi.NodePublishVolumeRequest) error
 }
 
 // IdempotentInterceptorOption configures the idempotent interceptor.
 type IdempotentInterceptorOption func(*idempIntercOpts)
 
 type idempIntercOpts struct {
-	timeout       time.Duration
-	requireVolume bool
+	timeout        time.Duration
+	timeoutFor     map[string]time.Duration
+	requireVolume  bool
+	abortOnPending bool
+	store          IdempotencyStore
+}
+
+// lockTimeout returns the lock-acquisition timeout configured for
+// method via WithIdempTimeoutFor, falling back to the interceptor-wide
+// WithIdempTimeout, and finally to zero, which tryAcquire treats as a
+// single, non-blocking lock attempt.
+func (o *idempIntercOpts) lockTimeout(method string) time.Duration {
+	if d, ok := o.timeoutFor[method]; ok {
+		return d
+	}
+	return o.timeout
+}
+
+// WithIdempotencyStore is an IdempotentInterceptorOption that configures
+// the idempotent interceptor to persist the methodInErr set -- which
+// keys/methods are currently known to be in error -- to the provided
+// IdempotencyStore, rather than only in memory. This is narrower than
+// persisting the RPCs' actual idempotent replies: those are always
+// rebuilt from the IdempotencyProvider's live state (e.g.
+// IsControllerPublished), not from this store, so a crash mid-RPC is
+// not made safe by this option alone. What it does provide is that a
+// restarted process remembers a key/method was last seen failing, so
+// a retried call for it falls through to the real handler instead of
+// a freshly started, empty methodInErr set wrongly treating it as
+// idempotent-successful. If this option is not supplied, an in-memory
+// store that does not survive a restart is used, matching the
+// interceptor's original behavior.
+func WithIdempotencyStore(s IdempotencyStore) IdempotentInterceptorOption {
+	return func(o *idempIntercOpts) {
+		o.store = s
+	}
 }
 
 // WithIdempTimeout is an IdempotentInterceptorOption that sets the
-// timeout used by the idempotent interceptor.
+// default lock-acquisition timeout used by the idempotent interceptor
+// for any RPC without a more specific WithIdempTimeoutFor setting.
 func WithIdempTimeout(t time.Duration) IdempotentInterceptorOption {
 	return func(o *idempIntercOpts) {
 		o.timeout = t
 	}
 }
 
+// WithIdempTimeoutFor is an IdempotentInterceptorOption that sets the
+// lock-acquisition timeout for a specific RPC's full method name (e.g.
+// "/csi.Controller/CreateVolume"), overriding the interceptor's default
+// set via WithIdempTimeout. This lets a slow RPC like CreateVolume be
+// given a 30-60s window to wait out lock contention while a fast RPC
+// like NodePublishVolume keeps a short one, matching the per-RPC
+// timeouts external-provisioner/attacher apply to their own calls.
+func WithIdempTimeoutFor(method string, d time.Duration) IdempotentInterceptorOption {
+	return func(o *idempIntercOpts) {
+		if o.timeoutFor == nil {
+			o.timeoutFor = map[string]time.Duration{}
+		}
+		o.timeoutFor[method] = d
+	}
+}
+
 // WithIdempRequireVolumeExists is an IdempotentInterceptorOption that
 // enforces the requirement that volumes must exist before proceeding
 // with an operation.
@@ -65,24 +165,84 @@ func WithIdempRequireVolumeExists() IdempotentInterceptorOption {
 	}
 }
 
+// WithAbortOnPending is an IdempotentInterceptorOption that causes the
+// idempotent interceptor to return a gRPC Aborted status when a volume's
+// lock is already held, instead of an OPERATION_PENDING_FOR_VOLUME error
+// embedded in the RPC's response. This lets external-provisioner/attacher
+// retry with proper backoff rather than treating contention as a terminal
+// error. This will become the default behavior in a future major version.
+func WithAbortOnPending() IdempotentInterceptorOption {
+	return func(o *idempIntercOpts) {
+		o.abortOnPending = true
+	}
+}
+
+// errAborted returns the gRPC Aborted status returned for key when the
+// idempotent interceptor is configured WithAbortOnPending.
+func errAborted(key string) error {
+	return status.Errorf(
+		codes.Aborted, "operation already in progress for volume %q", key)
+}
+
+// OperationLockClass identifies an independent class of volume
+// operation for locking purposes. Each class is backed by its own
+// VolumeLocks, so contention in one class (e.g. a stuck DeleteVolume)
+// cannot wedge operations in an unrelated class (e.g. a publish on a
+// different node). This mirrors the granular-locking redesign ceph-csi
+// adopted to fix contention under concurrent PVC creation.
+type OperationLockClass int
+
+const (
+	// OperationLockCreateDelete guards CreateVolume (by volume ID, once
+	// the volume is known to exist) and DeleteVolume.
+	OperationLockCreateDelete OperationLockClass = iota
+
+	// OperationLockPublishUnpublish guards ControllerPublishVolume and
+	// ControllerUnpublishVolume, keyed by volumeID+"/"+nodeID so that
+	// publishing the same volume on different nodes proceeds in
+	// parallel, as well as NodePublishVolume/NodeUnpublishVolume, keyed
+	// by volume ID.
+	OperationLockPublishUnpublish
+
+	// OperationLockExpand guards ControllerExpandVolume and
+	// NodeExpandVolume.
+	OperationLockExpand
+
+	// OperationLockSnapshot guards CreateSnapshot and DeleteSnapshot.
+	OperationLockSnapshot
+)
+
 // NewIdempotentInterceptor returns a new server-side, gRPC interceptor
 // that can be used in conjunction with an IdempotencyProvider to
 // provide serialized, idempotent access to the following CSI RPCs:
 //
-//  * CreateVolume
-//  * DeleteVolume
-//  * ControllerPublishVolume
-//  * ControllerUnpublishVolume
-//  * NodePublishVolume
-//  * NodeUnpublishVolume
+//   - CreateVolume
+//   - DeleteVolume
+//   - ControllerPublishVolume
+//   - ControllerUnpublishVolume
+//   - NodePublishVolume
+//   - NodeUnpublishVolume
+//   - CreateSnapshot
+//   - DeleteSnapshot
+//   - ControllerExpandVolume
+//   - NodeExpandVolume
+//
+// ListSnapshots is read-only and therefore already idempotent; it is
+// passed straight through to its handler without any additional locking.
 func NewIdempotentInterceptor(
 	p IdempotencyProvider,
 	opts ...IdempotentInterceptorOption) grpc.UnaryServerInterceptor {
 
 	i := &idempotencyInterceptor{
 		p:            p,
-		volIDLocks:   map[string]*volLockInfo{},
-		volNameLocks: map[string]*volLockInfo{},
+		volNameLocks: NewVolumeLocks(),
+		locks: map[OperationLockClass]*VolumeLocks{
+			OperationLockCreateDelete:     NewVolumeLocks(),
+			OperationLockPublishUnpublish: NewVolumeLocks(),
+			OperationLockExpand:           NewVolumeLocks(),
+			OperationLockSnapshot:         NewVolumeLocks(),
+		},
+		methodInErr: map[string]map[string]struct{}{},
 	}
 
 	// Configure the idempotent interceptor's options.
@@ -90,49 +250,160 @@ func NewIdempotentInterceptor(
 		setOpt(&i.opts)
 	}
 
+	// If the caller did not supply a durable store then fall back to an
+	// in-memory one that behaves exactly as it did before this option
+	// existed -- i.e. it does not survive a restart.
+	if i.opts.store == nil {
+		i.opts.store = NewMemIdempotencyStore()
+	}
+
+	// Hydrate the in-memory methodInErr set from the store so that a
+	// freshly started process picks back up where a prior instance left
+	// off, rather than starting with an empty set and wrongly treating a
+	// key/method that was last seen failing as eligible for an
+	// idempotent short-circuit.
+	i.loadMethodInErr(context.Background())
+
 	return i.handle
 }
 
-type volLockInfo struct {
-	MutexWithTryLock
-	methodInErr map[string]struct{}
+type idempotencyInterceptor struct {
+	p IdempotencyProvider
+
+	// volNameLocks guards CreateVolume by the requested volume name,
+	// before the volume (and therefore its ID) is known to exist.
+	volNameLocks *VolumeLocks
+
+	// locks holds one VolumeLocks per OperationLockClass, so that
+	// operations in unrelated classes never contend with each other.
+	locks map[OperationLockClass]*VolumeLocks
+
+	errL        sync.Mutex
+	methodInErr map[string]map[string]struct{}
+
+	opts idempIntercOpts
 }
 
-type idempotencyInterceptor struct {
-	p             IdempotencyProvider
-	volIDLocksL   sync.Mutex
-	volNameLocksL sync.Mutex
-	volIDLocks    map[string]*volLockInfo
-	volNameLocks  map[string]*volLockInfo
-	opts          idempIntercOpts
+// markMethodInErr notes that the most recent call to method for key ended
+// in error, so that a subsequent call bypasses idempotency and falls
+// through to the real handler.
+func (i *idempotencyInterceptor) markMethodInErr(
+	ctx context.Context, key, method string) {
+
+	i.errL.Lock()
+	defer i.errL.Unlock()
+	m := i.methodInErr[key]
+	if m == nil {
+		m = map[string]struct{}{}
+		i.methodInErr[key] = m
+	}
+	m[method] = struct{}{}
+	i.saveMethodInErrLocked(ctx, key, m)
 }
 
-func (i *idempotencyInterceptor) lockWithID(id string) *volLockInfo {
-	i.volIDLocksL.Lock()
-	defer i.volIDLocksL.Unlock()
-	lock := i.volIDLocks[id]
-	if lock == nil {
-		lock = &volLockInfo{
-			MutexWithTryLock: NewMutexWithTryLock(),
-			methodInErr:      map[string]struct{}{},
+// clearMethodInErr reclaims the in-error mark left by markMethodInErr,
+// e.g. once a retried call for the same key succeeds.
+func (i *idempotencyInterceptor) clearMethodInErr(
+	ctx context.Context, key, method string) {
+
+	i.errL.Lock()
+	defer i.errL.Unlock()
+	m := i.methodInErr[key]
+	if m == nil {
+		return
+	}
+	delete(m, method)
+	if len(m) == 0 {
+		delete(i.methodInErr, key)
+	}
+	i.saveMethodInErrLocked(ctx, key, m)
+}
+
+func (i *idempotencyInterceptor) isMethodInErr(key, method string) bool {
+	i.errL.Lock()
+	defer i.errL.Unlock()
+	_, ok := i.methodInErr[key][method]
+	return ok
+}
+
+// methodInErrKeyPrefix namespaces this interceptor's entries within a
+// shared IdempotencyStore.
+const methodInErrKeyPrefix = "methodInErr/"
+
+// saveMethodInErrLocked persists key's in-error method set to the
+// configured IdempotencyStore. The caller must hold i.errL.
+func (i *idempotencyInterceptor) saveMethodInErrLocked(
+	ctx context.Context, key string, m map[string]struct{}) {
+
+	storeKey := methodInErrKeyPrefix + key
+	if len(m) == 0 {
+		if err := i.opts.store.Delete(ctx, storeKey); err != nil {
+			log.WithError(err).WithField("key", key).Error(
+				"failed to delete idempotency store entry")
 		}
-		i.volIDLocks[id] = lock
+		return
+	}
+
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
+	}
+	val := []byte(strings.Join(methods, "\n"))
+	if err := i.opts.store.Put(ctx, storeKey, val); err != nil {
+		log.WithError(err).WithField("key", key).Error(
+			"failed to persist idempotency store entry")
 	}
-	return lock
 }
 
-func (i *idempotencyInterceptor) lockWithName(name string) *volLockInfo {
-	i.volNameLocksL.Lock()
-	defer i.volNameLocksL.Unlock()
-	lock := i.volNameLocks[name]
-	if lock == nil {
-		lock = &volLockInfo{
-			MutexWithTryLock: NewMutexWithTryLock(),
-			methodInErr:      map[string]struct{}{},
+// loadMethodInErr populates the in-memory methodInErr set from the
+// configured IdempotencyStore. It is called once, from
+// NewIdempotentInterceptor, so that a freshly started process resumes
+// with the same idempotency bookkeeping a prior instance left behind.
+func (i *idempotencyInterceptor) loadMethodInErr(ctx context.Context) {
+	keys, err := i.opts.store.List(ctx, methodInErrKeyPrefix)
+	if err != nil {
+		log.WithError(err).Error("failed to list idempotency store entries")
+		return
+	}
+
+	for _, storeKey := range keys {
+		val, err := i.opts.store.Get(ctx, storeKey)
+		if err != nil {
+			log.WithError(err).WithField("key", storeKey).Error(
+				"failed to read idempotency store entry")
+			continue
 		}
-		i.volNameLocks[name] = lock
+		if len(val) == 0 {
+			continue
+		}
+
+		key := strings.TrimPrefix(storeKey, methodInErrKeyPrefix)
+		m := map[string]struct{}{}
+		for _, method := range strings.Split(string(val), "\n") {
+			if method != "" {
+				m[method] = struct{}{}
+			}
+		}
+		i.methodInErr[key] = m
+	}
+}
+
+// tryAcquire attempts to lock key in locks, honoring the lock-acquisition
+// timeout configured for method via WithIdempTimeout/WithIdempTimeoutFor.
+// With no timeout configured, it fails fast with a single non-blocking
+// TryAcquire, matching the original MutexWithTryLock.TryLock(0) default,
+// rather than polling ctx -- which may carry no deadline of its own --
+// potentially forever.
+func (i *idempotencyInterceptor) tryAcquire(
+	ctx context.Context, locks *VolumeLocks, key, method string) bool {
+
+	d := i.opts.lockTimeout(method)
+	if d <= 0 {
+		return locks.TryAcquire(key)
 	}
-	return lock
+	lctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	return locks.TryAcquireContext(lctx, key)
 }
 
 func (i *idempotencyInterceptor) handle(
@@ -154,6 +425,14 @@ func (i *idempotencyInterceptor) handle(
 		return i.nodePublishVolume(ctx, treq, info, handler)
 	case *csi.NodeUnpublishVolumeRequest:
 		return i.nodeUnpublishVolume(ctx, treq, info, handler)
+	case *csi.CreateSnapshotRequest:
+		return i.createSnapshot(ctx, treq, info, handler)
+	case *csi.DeleteSnapshotRequest:
+		return i.deleteSnapshot(ctx, treq, info, handler)
+	case *csi.ControllerExpandVolumeRequest:
+		return i.controllerExpandVolume(ctx, treq, info, handler)
+	case *csi.NodeExpandVolumeRequest:
+		return i.nodeExpandVolume(ctx, treq, info, handler)
 	}
 
 	return handler(ctx, req)
@@ -165,8 +444,11 @@ func (i *idempotencyInterceptor) controllerPublishVolume(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (res interface{}, resErr error) {
 
-	lock := i.lockWithID(req.VolumeId)
-	if !lock.TryLock(i.opts.timeout) {
+	lockKey := req.VolumeId + "/" + req.NodeId
+	if !i.tryAcquire(ctx, i.locks[OperationLockPublishUnpublish], lockKey, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(lockKey)
+		}
 		return ErrControllerPublishVolume(
 			csi.Error_ControllerPublishVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -182,17 +464,17 @@ func (i *idempotencyInterceptor) controllerPublishVolume(
 	defer func() {
 		if resErr != nil ||
 			res.(*csi.ControllerPublishVolumeResponse).GetError() != nil {
-			lock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := lock.methodInErr[info.FullMethod]; ok {
-			delete(lock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, lockKey, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, lockKey, info.FullMethod)
 		}
 	}()
-	defer lock.Unlock()
+	defer i.locks[OperationLockPublishUnpublish].Release(lockKey)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := lock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(lockKey, info.FullMethod) {
 		return handler(ctx, req)
 	}
 
@@ -215,6 +497,17 @@ func (i *idempotencyInterceptor) controllerPublishVolume(
 		return nil, err
 	}
 	if pubInfo != nil {
+		// The volume is already published to this node. Only treat this
+		// as an idempotent retry if the existing publication is
+		// compatible with what's being requested now; otherwise the CO
+		// is asking for something genuinely different for this node and
+		// that must fail rather than silently succeed.
+		if err := i.p.ComparePublishedVolume(ctx, pubInfo, req); err != nil {
+			return ErrControllerPublishVolume(
+				csi.Error_ControllerPublishVolumeError_VOLUME_ALREADY_PUBLISHED,
+				err.Error()), nil
+		}
+
 		log.WithField("volumeID", req.VolumeId).Info(
 			"idempotent controller publish")
 		return &csi.ControllerPublishVolumeResponse{
@@ -235,8 +528,11 @@ func (i *idempotencyInterceptor) controllerUnpublishVolume(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (res interface{}, resErr error) {
 
-	lock := i.lockWithID(req.VolumeId)
-	if !lock.TryLock(i.opts.timeout) {
+	lockKey := req.VolumeId + "/" + req.NodeId
+	if !i.tryAcquire(ctx, i.locks[OperationLockPublishUnpublish], lockKey, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(lockKey)
+		}
 		return ErrControllerUnpublishVolume(
 			csi.Error_ControllerUnpublishVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -252,17 +548,17 @@ func (i *idempotencyInterceptor) controllerUnpublishVolume(
 	defer func() {
 		if resErr != nil ||
 			res.(*csi.ControllerUnpublishVolumeResponse).GetError() != nil {
-			lock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := lock.methodInErr[info.FullMethod]; ok {
-			delete(lock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, lockKey, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, lockKey, info.FullMethod)
 		}
 	}()
-	defer lock.Unlock()
+	defer i.locks[OperationLockPublishUnpublish].Release(lockKey)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := lock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(lockKey, info.FullMethod) {
 		return handler(ctx, req)
 	}
 
@@ -305,8 +601,10 @@ func (i *idempotencyInterceptor) createVolume(
 
 	// First attempt to lock the volume by the provided name. If no lock
 	// can be obtained then exit with the appropriate error.
-	nameLock := i.lockWithName(req.Name)
-	if !nameLock.TryLock(i.opts.timeout) {
+	if !i.tryAcquire(ctx, i.volNameLocks, req.Name, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.Name)
+		}
 		return ErrCreateVolume(
 			csi.Error_CreateVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -320,9 +618,18 @@ func (i *idempotencyInterceptor) createVolume(
 	// marked in error in the past and remove that mark to reclaim
 	// memory.
 	defer func() {
-		if resErr != nil ||
-			res.(*csi.CreateVolumeResponse).GetError() != nil {
+		// A gRPC Aborted status means a nested lock (the id-based lock
+		// below) was contended; that's transient and should not poison
+		// the name lock's error state the way a real failure would.
+		if resErr != nil {
+			if status.Code(resErr) == codes.Aborted {
+				return
+			}
+			i.markMethodInErr(ctx, req.Name, info.FullMethod)
+			return
+		}
 
+		if res.(*csi.CreateVolumeResponse).GetError() != nil {
 			// Check to see if the error code is OPERATION_PENDING_FOR_VOLUME.
 			// If it is then do not mark this method in error.
 			terr := res.(*csi.CreateVolumeResponse).GetError()
@@ -332,17 +639,17 @@ func (i *idempotencyInterceptor) createVolume(
 					csi.Error_CreateVolumeError_OPERATION_PENDING_FOR_VOLUME {
 				return
 			}
-			nameLock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := nameLock.methodInErr[info.FullMethod]; ok {
-			delete(nameLock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, req.Name, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, req.Name, info.FullMethod)
 		}
 	}()
-	defer nameLock.Unlock()
+	defer i.volNameLocks.Release(req.Name)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := nameLock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(req.Name, info.FullMethod) {
 		log.WithField("volumeName", req.Name).Warn("creating volume: nameInErr")
 		return handler(ctx, req)
 	}
@@ -363,8 +670,10 @@ func (i *idempotencyInterceptor) createVolume(
 	// If the volInfo is not nil it means the volume already exists.
 	// The volume info contains the volume's ID. Use that to obtain a
 	// volume ID-based lock for the volume.
-	idLock := i.lockWithID(volInfo.Id)
-	if !idLock.TryLock(i.opts.timeout) {
+	if !i.tryAcquire(ctx, i.locks[OperationLockCreateDelete], volInfo.Id, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(volInfo.Id)
+		}
 		return ErrCreateVolume(
 			csi.Error_CreateVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -377,20 +686,20 @@ func (i *idempotencyInterceptor) createVolume(
 	// If neither is true then check to see if the method has been
 	// marked in error in the past and remove that mark to reclaim
 	// memory.
-	defer func() {
+	defer func(id string) {
 		if resErr != nil ||
 			res.(*csi.CreateVolumeResponse).GetError() != nil {
-			idLock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := idLock.methodInErr[info.FullMethod]; ok {
-			delete(idLock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, id, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, id, info.FullMethod)
 		}
-	}()
-	defer idLock.Unlock()
+	}(volInfo.Id)
+	defer i.locks[OperationLockCreateDelete].Release(volInfo.Id)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := idLock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(volInfo.Id, info.FullMethod) {
 		log.WithField("volumeName", req.Name).Warn("creating volume: idInErr")
 		return handler(ctx, req)
 	}
@@ -412,6 +721,17 @@ func (i *idempotencyInterceptor) createVolume(
 		return handler(ctx, req)
 	}
 
+	// The volume exists. Only treat this as an idempotent retry if it's
+	// compatible with the request at hand -- same capacity range,
+	// capabilities, parameters, and content source -- otherwise the
+	// caller is asking to create a genuinely different volume under a
+	// name that's already taken.
+	if err := i.p.CompareVolume(ctx, volInfo, req); err != nil {
+		return ErrCreateVolume(
+			csi.Error_CreateVolumeError_VOLUME_ALREADY_EXISTS,
+			err.Error()), nil
+	}
+
 	// If the volume info still exists then it means the volume
 	// exists! Go ahead and return the volume info and note this
 	// as an idempotent create call.
@@ -433,8 +753,10 @@ func (i *idempotencyInterceptor) deleteVolume(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (res interface{}, resErr error) {
 
-	lock := i.lockWithID(req.VolumeId)
-	if !lock.TryLock(i.opts.timeout) {
+	if !i.tryAcquire(ctx, i.locks[OperationLockCreateDelete], req.VolumeId, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.VolumeId)
+		}
 		return ErrDeleteVolume(
 			csi.Error_DeleteVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -450,17 +772,17 @@ func (i *idempotencyInterceptor) deleteVolume(
 	defer func() {
 		if resErr != nil ||
 			res.(*csi.DeleteVolumeResponse).GetError() != nil {
-			lock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := lock.methodInErr[info.FullMethod]; ok {
-			delete(lock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, req.VolumeId, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, req.VolumeId, info.FullMethod)
 		}
 	}()
-	defer lock.Unlock()
+	defer i.locks[OperationLockCreateDelete].Release(req.VolumeId)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := lock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(req.VolumeId, info.FullMethod) {
 		return handler(ctx, req)
 	}
 
@@ -509,8 +831,10 @@ func (i *idempotencyInterceptor) nodePublishVolume(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (res interface{}, resErr error) {
 
-	lock := i.lockWithID(req.VolumeId)
-	if !lock.TryLock(i.opts.timeout) {
+	if !i.tryAcquire(ctx, i.locks[OperationLockPublishUnpublish], req.VolumeId, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.VolumeId)
+		}
 		return ErrNodePublishVolume(
 			csi.Error_NodePublishVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -526,17 +850,17 @@ func (i *idempotencyInterceptor) nodePublishVolume(
 	defer func() {
 		if resErr != nil ||
 			res.(*csi.NodePublishVolumeResponse).GetError() != nil {
-			lock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := lock.methodInErr[info.FullMethod]; ok {
-			delete(lock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, req.VolumeId, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, req.VolumeId, info.FullMethod)
 		}
 	}()
-	defer lock.Unlock()
+	defer i.locks[OperationLockPublishUnpublish].Release(req.VolumeId)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := lock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(req.VolumeId, info.FullMethod) {
 		return handler(ctx, req)
 	}
 
@@ -560,6 +884,15 @@ func (i *idempotencyInterceptor) nodePublishVolume(
 		return nil, err
 	}
 	if ok {
+		// The volume is already published at this target path. Only
+		// treat this as an idempotent retry if the existing publication
+		// is compatible with what's being requested now.
+		if err := i.p.CompareNodePublishedVolume(ctx, req.VolumeId, req); err != nil {
+			return ErrNodePublishVolume(
+				csi.Error_NodePublishVolumeError_VOLUME_ALREADY_PUBLISHED,
+				err.Error()), nil
+		}
+
 		log.WithField("volumeId", req.VolumeId).Info("idempotent node publish")
 		return &csi.NodePublishVolumeResponse{
 			Reply: &csi.NodePublishVolumeResponse_Result_{
@@ -577,8 +910,10 @@ func (i *idempotencyInterceptor) nodeUnpublishVolume(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (res interface{}, resErr error) {
 
-	lock := i.lockWithID(req.VolumeId)
-	if !lock.TryLock(i.opts.timeout) {
+	if !i.tryAcquire(ctx, i.locks[OperationLockPublishUnpublish], req.VolumeId, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.VolumeId)
+		}
 		return ErrNodeUnpublishVolume(
 			csi.Error_NodeUnpublishVolumeError_OPERATION_PENDING_FOR_VOLUME,
 			""), nil
@@ -594,17 +929,17 @@ func (i *idempotencyInterceptor) nodeUnpublishVolume(
 	defer func() {
 		if resErr != nil ||
 			res.(*csi.NodeUnpublishVolumeResponse).GetError() != nil {
-			lock.methodInErr[info.FullMethod] = struct{}{}
-		} else if _, ok := lock.methodInErr[info.FullMethod]; ok {
-			delete(lock.methodInErr, info.FullMethod)
+			i.markMethodInErr(ctx, req.VolumeId, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, req.VolumeId, info.FullMethod)
 		}
 	}()
-	defer lock.Unlock()
+	defer i.locks[OperationLockPublishUnpublish].Release(req.VolumeId)
 
 	// If the method has been marked in error then it means a previous
 	// call to this function returned an error. In these cases a
 	// subsequent call should bypass idempotency.
-	if _, ok := lock.methodInErr[info.FullMethod]; ok {
+	if i.isMethodInErr(req.VolumeId, info.FullMethod) {
 		return handler(ctx, req)
 	}
 
@@ -638,3 +973,195 @@ func (i *idempotencyInterceptor) nodeUnpublishVolume(
 
 	return handler(ctx, req)
 }
+
+func (i *idempotencyInterceptor) createSnapshot(
+	ctx context.Context,
+	req *csi.CreateSnapshotRequest,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (res interface{}, resErr error) {
+
+	if !i.tryAcquire(ctx, i.locks[OperationLockSnapshot], req.Name, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.Name)
+		}
+		return ErrCreateSnapshot(
+			csi.Error_CreateSnapshotError_OPERATION_PENDING_FOR_VOLUME,
+			""), nil
+	}
+
+	// At the end of this function check for a response error or if
+	// the response itself contains an error. If either is true then
+	// mark the current method as in error.
+	//
+	// If neither is true then check to see if the method has been
+	// marked in error in the past and remove that mark to reclaim
+	// memory.
+	defer func() {
+		if resErr != nil ||
+			res.(*csi.CreateSnapshotResponse).GetError() != nil {
+			i.markMethodInErr(ctx, req.Name, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, req.Name, info.FullMethod)
+		}
+	}()
+	defer i.locks[OperationLockSnapshot].Release(req.Name)
+
+	// If the method has been marked in error then it means a previous
+	// call to this function returned an error. In these cases a
+	// subsequent call should bypass idempotency.
+	if i.isMethodInErr(req.Name, info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	id, err := i.p.GetSnapshotID(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the snapshot does not exist then pass control to the next
+	// handler in the chain.
+	if id == "" {
+		return handler(ctx, req)
+	}
+
+	snapInfo, err := i.p.GetSnapshotInfo(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	if snapInfo == nil {
+		return handler(ctx, req)
+	}
+
+	log.WithFields(map[string]interface{}{
+		"snapshotID":   snapInfo.Id,
+		"snapshotName": req.Name}).Info("idempotent create snapshot")
+	return &csi.CreateSnapshotResponse{
+		Reply: &csi.CreateSnapshotResponse_Result_{
+			Result: &csi.CreateSnapshotResponse_Result{
+				Snapshot: snapInfo,
+			},
+		},
+	}, nil
+}
+
+func (i *idempotencyInterceptor) deleteSnapshot(
+	ctx context.Context,
+	req *csi.DeleteSnapshotRequest,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (res interface{}, resErr error) {
+
+	if !i.tryAcquire(ctx, i.locks[OperationLockSnapshot], req.SnapshotId, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.SnapshotId)
+		}
+		return ErrDeleteSnapshot(
+			csi.Error_DeleteSnapshotError_OPERATION_PENDING_FOR_VOLUME,
+			""), nil
+	}
+
+	// At the end of this function check for a response error or if
+	// the response itself contains an error. If either is true then
+	// mark the current method as in error.
+	//
+	// If neither is true then check to see if the method has been
+	// marked in error in the past and remove that mark to reclaim
+	// memory.
+	defer func() {
+		if resErr != nil ||
+			res.(*csi.DeleteSnapshotResponse).GetError() != nil {
+			i.markMethodInErr(ctx, req.SnapshotId, info.FullMethod)
+		} else {
+			i.clearMethodInErr(ctx, req.SnapshotId, info.FullMethod)
+		}
+	}()
+	defer i.locks[OperationLockSnapshot].Release(req.SnapshotId)
+
+	// If the method has been marked in error then it means a previous
+	// call to this function returned an error. In these cases a
+	// subsequent call should bypass idempotency.
+	if i.isMethodInErr(req.SnapshotId, info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	snapInfo, err := i.p.GetSnapshotInfo(ctx, req.SnapshotId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Indicate an idempotent delete operation if the snapshot does not
+	// exist.
+	if snapInfo == nil {
+		log.WithField("snapshotID", req.SnapshotId).Info(
+			"idempotent delete snapshot")
+		return &csi.DeleteSnapshotResponse{
+			Reply: &csi.DeleteSnapshotResponse_Result_{
+				Result: &csi.DeleteSnapshotResponse_Result{},
+			},
+		}, nil
+	}
+
+	return handler(ctx, req)
+}
+
+func (i *idempotencyInterceptor) controllerExpandVolume(
+	ctx context.Context,
+	req *csi.ControllerExpandVolumeRequest,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (res interface{}, resErr error) {
+
+	if !i.tryAcquire(ctx, i.locks[OperationLockExpand], req.VolumeId, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.VolumeId)
+		}
+		return ErrControllerExpandVolume(
+			csi.Error_ControllerExpandVolumeError_OPERATION_PENDING_FOR_VOLUME,
+			""), nil
+	}
+	defer i.locks[OperationLockExpand].Release(req.VolumeId)
+
+	size, err := i.p.GetVolumeSize(ctx, req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+
+	// A request whose target size is already satisfied by the volume's
+	// current size is an idempotent no-op; return the current size
+	// rather than re-running the expansion.
+	if cr := req.CapacityRange; cr != nil && cr.RequiredBytes <= size {
+		log.WithField("volumeID", req.VolumeId).Info(
+			"idempotent controller expand")
+		return &csi.ControllerExpandVolumeResponse{
+			Reply: &csi.ControllerExpandVolumeResponse_Result_{
+				Result: &csi.ControllerExpandVolumeResponse_Result{
+					CapacityBytes: size,
+				},
+			},
+		}, nil
+	}
+
+	return handler(ctx, req)
+}
+
+func (i *idempotencyInterceptor) nodeExpandVolume(
+	ctx context.Context,
+	req *csi.NodeExpandVolumeRequest,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+
+	// NodeExpandVolume's own idempotency (e.g. whether the on-disk
+	// filesystem was already grown) is plugin-specific and can't be
+	// inferred here, so this only serializes concurrent expand calls
+	// for the same volume; the handler remains responsible for
+	// tolerating a redundant call.
+	if !i.tryAcquire(ctx, i.locks[OperationLockExpand], req.VolumeId, info.FullMethod) {
+		if i.opts.abortOnPending {
+			return nil, errAborted(req.VolumeId)
+		}
+		return ErrNodeExpandVolume(
+			csi.Error_NodeExpandVolumeError_OPERATION_PENDING_FOR_VOLUME,
+			""), nil
+	}
+	defer i.locks[OperationLockExpand].Release(req.VolumeId)
+
+	return handler(ctx, req)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package gocsi
+
+import (
+	"errors"
+	"net"
+)
+
+// errVsockUnsupported is returned by ListenVsock and DialVsock on
+// platforms other than Linux, where AF_VSOCK is not available.
+var errVsockUnsupported = errors.New("vsock unsupported on this platform")
+
+// ListenVsock is unsupported outside of Linux.
+func ListenVsock(addr string) (net.Listener, error) {
+	return nil, errVsockUnsupported
+}
+
+// DialVsock is unsupported outside of Linux.
+func DialVsock(addr string) (net.Conn, error) {
+	return nil, errVsockUnsupported
+}
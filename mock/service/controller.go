@@ -7,6 +7,8 @@ import (
 	"strconv"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/thecodeteam/gocsi"
 	"github.com/thecodeteam/gocsi/csi"
@@ -17,6 +19,18 @@ func (s *service) CreateVolume(
 	req *csi.CreateVolumeRequest) (
 	*csi.CreateVolumeResponse, error) {
 
+	for _, k := range s.requiredSecrets {
+		if _, ok := req.Secrets[k]; !ok {
+			return nil, status.Errorf(
+				codes.InvalidArgument, "missing required secret key: %s", k)
+		}
+	}
+
+	if !s.volLocks.TryAcquire(req.Name) {
+		return nil, errOperationPending(req.Name)
+	}
+	defer s.volLocks.Release(req.Name)
+
 	// If no capacity is specified then use 100GiB
 	capacity := gib100
 	if cr := req.CapacityRange; cr != nil {
@@ -30,9 +44,39 @@ func (s *service) CreateVolume(
 
 	// Create the volume and add it to the service's in-mem volume slice.
 	v := s.newVolume(req.Name, capacity)
-	s.volsRWL.Lock()
-	defer s.volsRWL.Unlock()
-	s.vols = append(s.vols, v)
+
+	// Record the request's parameters on the volume so they can later be
+	// considered by ValidateVolumeCapabilities and surfaced to callers.
+	for k, val := range req.Parameters {
+		v.Attributes[k] = val
+	}
+
+	v.AccessibleTopology = accessibleTopology(req.AccessibilityRequirements)
+
+	// Honor a volume content source by raising the new volume's capacity
+	// to at least the source's size and, for a volume source, copying the
+	// source volume's attributes onto the new volume.
+	if src := req.VolumeContentSource; src != nil {
+		switch t := src.Type.(type) {
+		case *csi.VolumeContentSource_Snapshot:
+			s.snapshotsRWL.RLock()
+			_, sn := s.findSnapNoLock("id", t.Snapshot.Id)
+			s.snapshotsRWL.RUnlock()
+			if sn.SizeBytes > v.CapacityBytes {
+				v.CapacityBytes = sn.SizeBytes
+			}
+		case *csi.VolumeContentSource_Volume:
+			srcVol, _ := s.vols.Get(t.Volume.Id)
+			if srcVol.CapacityBytes > v.CapacityBytes {
+				v.CapacityBytes = srcVol.CapacityBytes
+			}
+			for k, val := range srcVol.Attributes {
+				v.Attributes[k] = val
+			}
+		}
+	}
+
+	s.vols.Put(v)
 
 	return &csi.CreateVolumeResponse{
 		Reply: &csi.CreateVolumeResponse_Result_{
@@ -48,18 +92,12 @@ func (s *service) DeleteVolume(
 	req *csi.DeleteVolumeRequest) (
 	*csi.DeleteVolumeResponse, error) {
 
-	func() {
-		s.volsRWL.Lock()
-		defer s.volsRWL.Unlock()
-		i, _ := s.findVolNoLock("id", req.VolumeId)
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
 
-		// This delete logic preserves order and prevents potential memory
-		// leaks. The slice's elements may not be pointers, but the structs
-		// themselves have fields that are.
-		copy(s.vols[i:], s.vols[i+1:])
-		s.vols[len(s.vols)-1] = csi.VolumeInfo{}
-		s.vols = s.vols[:len(s.vols)-1]
-	}()
+	s.vols.Delete(req.VolumeId)
 
 	return &csi.DeleteVolumeResponse{
 		Reply: &csi.DeleteVolumeResponse_Result_{
@@ -78,20 +116,28 @@ func (s *service) ControllerPublishVolume(
 	// to the specified node.
 	devPathKey := path.Join(req.NodeId, "dev")
 
-	s.volsRWL.Lock()
-	defer s.volsRWL.Unlock()
-	i, v := s.findVolNoLock("id", req.VolumeId)
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
 
 	// Publish the volume.
-	v.Attributes[devPathKey] = "/dev/mock"
-	s.vols[i] = v
+	s.vols.Update(req.VolumeId, func(v *csi.VolumeInfo) {
+		v.Attributes[devPathKey] = "/dev/mock"
+	})
+
+	// Carry the request's volume attributes through to the node, so
+	// NodePublishVolume sees the same context ControllerPublishVolume was
+	// called with rather than just the mock device path.
+	publishVolumeInfo := map[string]string{"device": "/dev/mock"}
+	for k, val := range req.VolumeAttributes {
+		publishVolumeInfo[k] = val
+	}
 
 	return &csi.ControllerPublishVolumeResponse{
 		Reply: &csi.ControllerPublishVolumeResponse_Result_{
 			Result: &csi.ControllerPublishVolumeResponse_Result{
-				PublishVolumeInfo: map[string]string{
-					"device": v.Attributes[devPathKey],
-				},
+				PublishVolumeInfo: publishVolumeInfo,
 			},
 		},
 	}, nil
@@ -107,13 +153,15 @@ func (s *service) ControllerUnpublishVolume(
 	// to the specified node.
 	devPathKey := path.Join(req.NodeId, "dev")
 
-	s.volsRWL.Lock()
-	defer s.volsRWL.Unlock()
-	i, v := s.findVolNoLock("id", req.VolumeId)
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
 
 	// Unpublish the volume.
-	delete(v.Attributes, devPathKey)
-	s.vols[i] = v
+	s.vols.Update(req.VolumeId, func(v *csi.VolumeInfo) {
+		delete(v.Attributes, devPathKey)
+	})
 
 	return &csi.ControllerUnpublishVolumeResponse{
 		Reply: &csi.ControllerUnpublishVolumeResponse_Result_{
@@ -127,6 +175,27 @@ func (s *service) ValidateVolumeCapabilities(
 	req *csi.ValidateVolumeCapabilitiesRequest) (
 	*csi.ValidateVolumeCapabilitiesResponse, error) {
 
+	v, _ := s.vols.Get(req.VolumeId)
+
+	// A volume created with parameters is only "supported" for a request
+	// whose parameters agree with the ones it was created with; this lets
+	// callers exercise the parameter contract rather than always getting
+	// back an unconditional true.
+	for k, val := range req.Parameters {
+		if v.Attributes[k] != val {
+			return &csi.ValidateVolumeCapabilitiesResponse{
+				Reply: &csi.ValidateVolumeCapabilitiesResponse_Result_{
+					Result: &csi.ValidateVolumeCapabilitiesResponse_Result{
+						Supported: false,
+						Message: fmt.Sprintf(
+							"parameter %q=%q does not match volume's %q=%q",
+							k, val, k, v.Attributes[k]),
+					},
+				},
+			}, nil
+		}
+	}
+
 	return &csi.ValidateVolumeCapabilitiesResponse{
 		Reply: &csi.ValidateVolumeCapabilitiesResponse_Result_{
 			Result: &csi.ValidateVolumeCapabilitiesResponse_Result{
@@ -141,16 +210,9 @@ func (s *service) ListVolumes(
 	req *csi.ListVolumesRequest) (
 	*csi.ListVolumesResponse, error) {
 
-	// Copy the mock volumes into a new slice in order to avoid
-	// locking the service's volume slice for the duration of the
-	// ListVolumes RPC.
-	var vols []csi.VolumeInfo
-	func() {
-		s.volsRWL.RLock()
-		defer s.volsRWL.RUnlock()
-		vols = make([]csi.VolumeInfo, len(s.vols))
-		copy(vols, s.vols)
-	}()
+	// List already returns a copy, so there's no need to hold the
+	// store's lock for the duration of the RPC.
+	vols := s.vols.List()
 
 	var (
 		ulenVols      = uint32(len(vols))
@@ -218,6 +280,19 @@ func (s *service) GetCapacity(
 	req *csi.GetCapacityRequest) (
 	*csi.GetCapacityResponse, error) {
 
+	// If the request is scoped to a topology this mock does not satisfy
+	// then report no available capacity there.
+	if t := req.AccessibleTopology; t != nil &&
+		!topologyMatches(s.nodeTopology, t.Segments) {
+		return &csi.GetCapacityResponse{
+			Reply: &csi.GetCapacityResponse_Result_{
+				Result: &csi.GetCapacityResponse_Result{
+					AvailableCapacity: 0,
+				},
+			},
+		}, nil
+	}
+
 	return &csi.GetCapacityResponse{
 		Reply: &csi.GetCapacityResponse_Result_{
 			Result: &csi.GetCapacityResponse_Result{
@@ -264,6 +339,34 @@ func (s *service) ControllerGetCapabilities(
 							},
 						},
 					},
+					&csi.ControllerServiceCapability{
+						Type: &csi.ControllerServiceCapability_Rpc{
+							Rpc: &csi.ControllerServiceCapability_RPC{
+								Type: csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+							},
+						},
+					},
+					&csi.ControllerServiceCapability{
+						Type: &csi.ControllerServiceCapability_Rpc{
+							Rpc: &csi.ControllerServiceCapability_RPC{
+								Type: csi.ControllerServiceCapability_RPC_VOLUME_ACCESSIBILITY_CONSTRAINTS,
+							},
+						},
+					},
+					&csi.ControllerServiceCapability{
+						Type: &csi.ControllerServiceCapability_Rpc{
+							Rpc: &csi.ControllerServiceCapability_RPC{
+								Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+							},
+						},
+					},
+					&csi.ControllerServiceCapability{
+						Type: &csi.ControllerServiceCapability_Rpc{
+							Rpc: &csi.ControllerServiceCapability_RPC{
+								Type: csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+							},
+						},
+					},
 				},
 			},
 		},
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/thecodeteam/gocsi/csi"
+)
+
+// nodeExpansionRequiredKey is the key in a volume's attributes that is
+// set once ControllerExpandVolume has grown the volume but the mock is
+// configured to require a follow-up NodeExpandVolume call before the
+// new size may be used.
+//
+// ControllerExpandVolume/NodeExpandVolume post-date the csi package this
+// repo vendors; a CSI spec version that actually defines
+// ControllerExpandVolumeRequest/Response and NodeExpandVolumeRequest/
+// Response (and the matching RPC_EXPAND_VOLUME capability) must be
+// pinned before this file will build against it.
+const nodeExpansionRequiredKey = "expansion/node-required"
+
+func (s *service) ControllerExpandVolume(
+	ctx context.Context,
+	req *csi.ControllerExpandVolumeRequest) (
+	*csi.ControllerExpandVolumeResponse, error) {
+
+	cr := req.CapacityRange
+	if cr == nil || cr.RequiredBytes == 0 {
+		return nil, status.Error(
+			codes.InvalidArgument, "capacity_range.required_bytes is required")
+	}
+
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
+
+	v, ok := s.vols.Get(req.VolumeId)
+	if !ok {
+		return nil, status.Errorf(
+			codes.NotFound, "volume not found: %s", req.VolumeId)
+	}
+
+	if cr.RequiredBytes < v.CapacityBytes {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"requested size %d is less than current size %d",
+			cr.RequiredBytes, v.CapacityBytes)
+	}
+
+	s.vols.Update(req.VolumeId, func(v *csi.VolumeInfo) {
+		v.CapacityBytes = cr.RequiredBytes
+		if s.requireNodeExpansion {
+			v.Attributes[nodeExpansionRequiredKey] = "true"
+		} else {
+			delete(v.Attributes, nodeExpansionRequiredKey)
+		}
+	})
+
+	return &csi.ControllerExpandVolumeResponse{
+		Reply: &csi.ControllerExpandVolumeResponse_Result_{
+			Result: &csi.ControllerExpandVolumeResponse_Result{
+				CapacityBytes:         cr.RequiredBytes,
+				NodeExpansionRequired: s.requireNodeExpansion,
+			},
+		},
+	}, nil
+}
+
+func (s *service) NodeExpandVolume(
+	ctx context.Context,
+	req *csi.NodeExpandVolumeRequest) (
+	*csi.NodeExpandVolumeResponse, error) {
+
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
+
+	// Mark the volume's node-side expansion as complete.
+	s.vols.Update(req.VolumeId, func(v *csi.VolumeInfo) {
+		delete(v.Attributes, nodeExpansionRequiredKey)
+	})
+	v, _ := s.vols.Get(req.VolumeId)
+
+	return &csi.NodeExpandVolumeResponse{
+		Reply: &csi.NodeExpandVolumeResponse_Result_{
+			Result: &csi.NodeExpandVolumeResponse_Result{
+				CapacityBytes: v.CapacityBytes,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errOperationPending returns the gRPC Aborted status a handler should
+// return when TryAcquire fails, so that well-behaved COs back off and
+// retry instead of treating the call as a terminal failure.
+func errOperationPending(key string) error {
+	return status.Errorf(
+		codes.Aborted, "an operation is already in progress for %q", key)
+}
+
+// VolumeLocks provides per-key, non-blocking locking so that operations
+// against unrelated volumes do not serialize behind one another. Unlike a
+// single mutex held for the duration of every RPC, a VolumeLocks entry only exists while the key is actually in use, so two
+// callers acting on different volumes never contend.
+type VolumeLocks struct {
+	locksL sync.Mutex
+	locks  map[string]struct{}
+}
+
+// NewVolumeLocks returns a new, empty VolumeLocks.
+func NewVolumeLocks() *VolumeLocks {
+	return &VolumeLocks{locks: map[string]struct{}{}}
+}
+
+// TryAcquire attempts to lock the provided key. It returns true if the
+// lock was acquired, or false if an operation is already in flight for
+// the same key.
+func (v *VolumeLocks) TryAcquire(key string) bool {
+	v.locksL.Lock()
+	defer v.locksL.Unlock()
+	if _, ok := v.locks[key]; ok {
+		return false
+	}
+	v.locks[key] = struct{}{}
+	return true
+}
+
+// Release releases the lock held for the provided key.
+func (v *VolumeLocks) Release(key string) {
+	v.locksL.Lock()
+	defer v.locksL.Unlock()
+	delete(v.locks, key)
+}
@@ -25,13 +25,15 @@ func (s *service) NodePublishVolume(
 	// mock mount path if the volume has been published by the node
 	nodeMntPathKey := path.Join(s.nodeID, req.TargetPath)
 
-	s.volsRWL.Lock()
-	defer s.volsRWL.Unlock()
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
 
 	// Publish the volume.
-	i, v := s.findVolNoLock("id", req.VolumeId)
-	v.Attributes[nodeMntPathKey] = device
-	s.vols[i] = v
+	s.vols.Update(req.VolumeId, func(v *csi.VolumeInfo) {
+		v.Attributes[nodeMntPathKey] = device
+	})
 
 	return &csi.NodePublishVolumeResponse{
 		Reply: &csi.NodePublishVolumeResponse_Result_{
@@ -49,13 +51,15 @@ func (s *service) NodeUnpublishVolume(
 	// mock mount path if the volume has been published by the node
 	nodeMntPathKey := path.Join(s.nodeID, req.TargetPath)
 
-	s.volsRWL.Lock()
-	defer s.volsRWL.Unlock()
+	if !s.volLocks.TryAcquire(req.VolumeId) {
+		return nil, errOperationPending(req.VolumeId)
+	}
+	defer s.volLocks.Release(req.VolumeId)
 
 	// Unpublish the volume.
-	i, v := s.findVolNoLock("id", req.VolumeId)
-	delete(v.Attributes, nodeMntPathKey)
-	s.vols[i] = v
+	s.vols.Update(req.VolumeId, func(v *csi.VolumeInfo) {
+		delete(v.Attributes, nodeMntPathKey)
+	})
 
 	return &csi.NodeUnpublishVolumeResponse{
 		Reply: &csi.NodeUnpublishVolumeResponse_Result_{
@@ -106,6 +110,13 @@ func (s *service) NodeGetCapabilities(
 							},
 						},
 					},
+					&csi.NodeServiceCapability{
+						Type: &csi.NodeServiceCapability_Rpc{
+							Rpc: &csi.NodeServiceCapability_RPC{
+								Type: csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
+							},
+						},
+					},
 				},
 			},
 		},
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thecodeteam/gocsi/csi"
+)
+
+const (
+	gib100 = 100 * 1024 * 1024 * 1024
+	tib100 = 100 * 1024 * 1024 * 1024 * 1024
+)
+
+// service implements the mock's Controller, Node, and Identity RPCs
+// against a VolumeStore and a set of per-volume locks. Each service owns
+// its own store and locks -- rather than sharing package globals -- so
+// that multiple instances in the same process, or back-to-back test
+// cases that each construct their own instance, never leak state into
+// one another.
+type service struct {
+	nodeID  string
+	volsIDN uint64
+	vols    VolumeStore
+
+	volLocks  *VolumeLocks
+	snapLocks *VolumeLocks
+
+	// requiredSecrets lists the keys that must be present in a
+	// CreateVolumeRequest's Secrets for the request to be honored.
+	requiredSecrets []string
+
+	// requireNodeExpansion controls whether ControllerExpandVolume
+	// reports that the expansion is complete (online resize) or that a
+	// subsequent NodeExpandVolume call is required to finish growing
+	// the filesystem (offline resize).
+	requireNodeExpansion bool
+
+	// nodeTopology is the set of topology labels this service
+	// advertises for the node it is running on.
+	nodeTopology map[string]string
+
+	snapshotsRWL sync.RWMutex
+	snapshots    []csi.SnapshotInfo
+	snapshotIDN  uint64
+}
+
+// Option configures a service constructed with New.
+type Option func(*service)
+
+// WithVolumeStore overrides the service's VolumeStore backend, in place
+// of the default in-memory store, e.g. to survive a process restart via
+// NewFileVolumeStore or NewCachePersisterVolumeStore.
+func WithVolumeStore(store VolumeStore) Option {
+	return func(s *service) { s.vols = store }
+}
+
+// WithRequiredSecrets sets the keys that must be present in a
+// CreateVolumeRequest's Secrets for the request to be honored. Tests use
+// this to exercise the secrets contract a CO is expected to satisfy.
+func WithRequiredSecrets(keys ...string) Option {
+	return func(s *service) { s.requiredSecrets = keys }
+}
+
+// WithRequireNodeExpansion configures the service to require a
+// follow-up NodeExpandVolume call after ControllerExpandVolume, i.e. to
+// simulate an offline resize.
+func WithRequireNodeExpansion() Option {
+	return func(s *service) { s.requireNodeExpansion = true }
+}
+
+// WithNodeTopology configures the topology labels this service
+// advertises for the node it is running on, so that topology-constrained
+// scheduling can be exercised against it.
+func WithNodeTopology(segments map[string]string) Option {
+	return func(s *service) { s.nodeTopology = segments }
+}
+
+// New returns a new instance of the mock's CSI service, identified to
+// callers as running on the node named nodeID.
+func New(nodeID string, opts ...Option) *service {
+	s := &service{
+		nodeID:       nodeID,
+		vols:         newSliceVolumeStore(),
+		volLocks:     NewVolumeLocks(),
+		snapLocks:    NewVolumeLocks(),
+		nodeTopology: map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// newVolume returns a new volume named name with the given capacity,
+// assigning it the service's next sequential volume ID.
+func (s *service) newVolume(name string, capacityBytes int64) csi.VolumeInfo {
+	s.volsIDN++
+	return csi.VolumeInfo{
+		Id:            fmt.Sprintf("%d", s.volsIDN),
+		Name:          name,
+		CapacityBytes: capacityBytes,
+		Attributes:    map[string]string{},
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/thecodeteam/gocsi"
+	"github.com/thecodeteam/gocsi/csi"
+)
+
+// findSnapNoLock mirrors findVol: it returns the index and value of the
+// first snapshot whose id or source volume id matches, or -1 and the
+// zero value if no snapshot matches.
+//
+// CreateSnapshot/DeleteSnapshot/ListSnapshots below, and the
+// RPC_CREATE_DELETE_SNAPSHOT capability advertised in controller.go,
+// depend on a CSI spec version this repo's vendored csi
+// package does not pin; that package isn't present in this tree to
+// regenerate, so the dependency is documented rather than silently
+// assumed.
+func (s *service) findSnapNoLock(field, val string) (int, csi.SnapshotInfo) {
+	for i, sn := range s.snapshots {
+		switch field {
+		case "id":
+			if sn.Id == val {
+				return i, sn
+			}
+		case "sourceVolumeId":
+			if sn.SourceVolumeId == val {
+				return i, sn
+			}
+		}
+	}
+	return -1, csi.SnapshotInfo{}
+}
+
+// newSnapshot returns a new snapshot named name, of the given source
+// volume and size, assigning it the service's next sequential
+// snapshot ID.
+func (s *service) newSnapshot(name, sourceVolumeID string, sizeBytes int64) csi.SnapshotInfo {
+	s.snapshotIDN++
+	return csi.SnapshotInfo{
+		Id:             fmt.Sprintf("%d", s.snapshotIDN),
+		Name:           name,
+		SourceVolumeId: sourceVolumeID,
+		SizeBytes:      sizeBytes,
+		CreatedAt:      time.Now().Unix(),
+		Status: &csi.SnapshotStatus{
+			Type: csi.SnapshotStatus_READY,
+		},
+	}
+}
+
+func (s *service) CreateSnapshot(
+	ctx context.Context,
+	req *csi.CreateSnapshotRequest) (
+	*csi.CreateSnapshotResponse, error) {
+
+	if !s.snapLocks.TryAcquire(req.Name) {
+		return nil, errOperationPending(req.Name)
+	}
+	defer s.snapLocks.Release(req.Name)
+
+	s.snapshotsRWL.Lock()
+	defer s.snapshotsRWL.Unlock()
+
+	// Idempotent: a snapshot with this name already exists.
+	for _, sn := range s.snapshots {
+		if sn.Name == req.Name {
+			return &csi.CreateSnapshotResponse{
+				Reply: &csi.CreateSnapshotResponse_Result_{
+					Result: &csi.CreateSnapshotResponse_Result{
+						Snapshot: &sn,
+					},
+				},
+			}, nil
+		}
+	}
+
+	v, _ := s.vols.Get(req.SourceVolumeId)
+
+	sn := s.newSnapshot(req.Name, req.SourceVolumeId, v.CapacityBytes)
+	s.snapshots = append(s.snapshots, sn)
+
+	return &csi.CreateSnapshotResponse{
+		Reply: &csi.CreateSnapshotResponse_Result_{
+			Result: &csi.CreateSnapshotResponse_Result{
+				Snapshot: &sn,
+			},
+		},
+	}, nil
+}
+
+func (s *service) DeleteSnapshot(
+	ctx context.Context,
+	req *csi.DeleteSnapshotRequest) (
+	*csi.DeleteSnapshotResponse, error) {
+
+	if !s.snapLocks.TryAcquire(req.SnapshotId) {
+		return nil, errOperationPending(req.SnapshotId)
+	}
+	defer s.snapLocks.Release(req.SnapshotId)
+
+	s.snapshotsRWL.Lock()
+	defer s.snapshotsRWL.Unlock()
+
+	i, _ := s.findSnapNoLock("id", req.SnapshotId)
+	if i >= 0 {
+		copy(s.snapshots[i:], s.snapshots[i+1:])
+		s.snapshots[len(s.snapshots)-1] = csi.SnapshotInfo{}
+		s.snapshots = s.snapshots[:len(s.snapshots)-1]
+	}
+
+	return &csi.DeleteSnapshotResponse{
+		Reply: &csi.DeleteSnapshotResponse_Result_{
+			Result: &csi.DeleteSnapshotResponse_Result{},
+		},
+	}, nil
+}
+
+func (s *service) ListSnapshots(
+	ctx context.Context,
+	req *csi.ListSnapshotsRequest) (
+	*csi.ListSnapshotsResponse, error) {
+
+	var snaps []csi.SnapshotInfo
+	func() {
+		s.snapshotsRWL.RLock()
+		defer s.snapshotsRWL.RUnlock()
+		snaps = make([]csi.SnapshotInfo, len(s.snapshots))
+		copy(snaps, s.snapshots)
+	}()
+
+	if v := req.SourceVolumeId; v != "" {
+		filtered := snaps[:0]
+		for _, sn := range snaps {
+			if sn.SourceVolumeId == v {
+				filtered = append(filtered, sn)
+			}
+		}
+		snaps = filtered
+	}
+	if v := req.SnapshotId; v != "" {
+		filtered := snaps[:0]
+		for _, sn := range snaps {
+			if sn.Id == v {
+				filtered = append(filtered, sn)
+			}
+		}
+		snaps = filtered
+	}
+
+	var (
+		ulenSnaps     = uint32(len(snaps))
+		maxEntries    = req.MaxEntries
+		startingToken uint32
+	)
+
+	if t := req.StartingToken; t != "" {
+		i, err := strconv.ParseUint(t, 10, 32)
+		if err != nil {
+			return gocsi.ErrListSnapshots(0, fmt.Sprintf(
+				"startingToken=%d !< uint32=%d",
+				startingToken, math.MaxUint32)), nil
+		}
+		startingToken = uint32(i)
+	}
+
+	if startingToken > ulenSnaps {
+		return gocsi.ErrListSnapshots(0, fmt.Sprintf(
+			"startingToken=%d > len(snapshots)=%d",
+			startingToken, ulenSnaps)), nil
+	}
+
+	rem := ulenSnaps - startingToken
+	if maxEntries == 0 || maxEntries > rem {
+		maxEntries = rem
+	}
+
+	var (
+		i       int
+		j       = startingToken
+		entries = make(
+			[]*csi.ListSnapshotsResponse_Result_Entry,
+			maxEntries)
+	)
+
+	for i = 0; i < len(entries); i++ {
+		entries[i] = &csi.ListSnapshotsResponse_Result_Entry{
+			Snapshot: &snaps[j],
+		}
+		j++
+	}
+
+	var nextToken string
+	if n := startingToken + uint32(i); n < ulenSnaps {
+		nextToken = fmt.Sprintf("%d", n)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Reply: &csi.ListSnapshotsResponse_Result_{
+			Result: &csi.ListSnapshotsResponse_Result{
+				Entries:   entries,
+				NextToken: nextToken,
+			},
+		},
+	}, nil
+}
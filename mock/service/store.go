@@ -0,0 +1,320 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/thecodeteam/gocsi/csi"
+)
+
+// VolumeStore abstracts the mock's volume bookkeeping away from a bare
+// slice-plus-mutex so that a restart-surviving backend can be swapped in
+// without touching the RPC handlers. Find mirrors the service's existing
+// lookup convention of a field name ("id" or "name") and a value.
+type VolumeStore interface {
+	// Get returns the volume with the given ID, and whether it exists.
+	Get(id string) (csi.VolumeInfo, bool)
+
+	// Find returns the position and value of the first volume whose
+	// field ("id" or "name") equals val. The position is -1 if no
+	// volume matches.
+	Find(field, val string) (int, csi.VolumeInfo)
+
+	// List returns a copy of all volumes.
+	List() []csi.VolumeInfo
+
+	// Put appends a new volume.
+	Put(v csi.VolumeInfo)
+
+	// Delete removes the volume with the given ID, if present.
+	Delete(id string)
+
+	// Update looks up the volume with the given ID and, if found, calls
+	// fn with a pointer to a copy of it and persists whatever mutation
+	// fn makes. It returns false if no volume with that ID exists.
+	Update(id string, fn func(v *csi.VolumeInfo)) bool
+}
+
+// sliceVolumeStore is the default VolumeStore: an in-memory slice that
+// does not survive a process restart, matching the mock's original
+// behavior.
+type sliceVolumeStore struct {
+	sync.RWMutex
+	vols []csi.VolumeInfo
+}
+
+func newSliceVolumeStore() *sliceVolumeStore {
+	return &sliceVolumeStore{}
+}
+
+func findVol(vols []csi.VolumeInfo, field, val string) (int, csi.VolumeInfo) {
+	for i, v := range vols {
+		switch field {
+		case "id":
+			if v.Id == val {
+				return i, v
+			}
+		case "name":
+			if v.Name == val {
+				return i, v
+			}
+		}
+	}
+	return -1, csi.VolumeInfo{}
+}
+
+func (s *sliceVolumeStore) Get(id string) (csi.VolumeInfo, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	i, v := findVol(s.vols, "id", id)
+	return v, i >= 0
+}
+
+func (s *sliceVolumeStore) Find(field, val string) (int, csi.VolumeInfo) {
+	s.RLock()
+	defer s.RUnlock()
+	return findVol(s.vols, field, val)
+}
+
+func (s *sliceVolumeStore) List() []csi.VolumeInfo {
+	s.RLock()
+	defer s.RUnlock()
+	vols := make([]csi.VolumeInfo, len(s.vols))
+	copy(vols, s.vols)
+	return vols
+}
+
+func (s *sliceVolumeStore) Put(v csi.VolumeInfo) {
+	s.Lock()
+	defer s.Unlock()
+	s.vols = append(s.vols, v)
+}
+
+func (s *sliceVolumeStore) Delete(id string) {
+	s.Lock()
+	defer s.Unlock()
+	i, _ := findVol(s.vols, "id", id)
+	if i < 0 {
+		return
+	}
+	copy(s.vols[i:], s.vols[i+1:])
+	s.vols[len(s.vols)-1] = csi.VolumeInfo{}
+	s.vols = s.vols[:len(s.vols)-1]
+}
+
+func (s *sliceVolumeStore) Update(id string, fn func(v *csi.VolumeInfo)) bool {
+	s.Lock()
+	defer s.Unlock()
+	i, v := findVol(s.vols, "id", id)
+	if i < 0 {
+		return false
+	}
+	fn(&v)
+	s.vols[i] = v
+	return true
+}
+
+// fileVolumeStore is a VolumeStore backed by a local JSON file, so that
+// mock state survives a restart of the process hosting it -- useful when
+// the mock runs as a sidecar under a CO that restarts the plugin between
+// controller and node calls.
+type fileVolumeStore struct {
+	sync.Mutex
+	path string
+}
+
+// NewFileVolumeStore returns a VolumeStore that persists to the JSON
+// file at path, creating it if it does not already exist. Pass the
+// result to WithVolumeStore to have the mock service survive a process
+// restart instead of losing its volumes to the default in-memory store.
+func NewFileVolumeStore(path string) (VolumeStore, error) {
+	return newFileVolumeStore(path)
+}
+
+// newFileVolumeStore returns a VolumeStore that persists to the JSON
+// file at path, creating it if it does not already exist.
+func newFileVolumeStore(path string) (*fileVolumeStore, error) {
+	s := &fileVolumeStore{path: path}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := s.save(nil); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *fileVolumeStore) load() ([]csi.VolumeInfo, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var vols []csi.VolumeInfo
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &vols); err != nil {
+			return nil, err
+		}
+	}
+	return vols, nil
+}
+
+func (s *fileVolumeStore) save(vols []csi.VolumeInfo) error {
+	data, err := json.Marshal(vols)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, data, 0600)
+}
+
+func (s *fileVolumeStore) Get(id string) (csi.VolumeInfo, bool) {
+	s.Lock()
+	defer s.Unlock()
+	vols, err := s.load()
+	if err != nil {
+		return csi.VolumeInfo{}, false
+	}
+	i, v := findVol(vols, "id", id)
+	return v, i >= 0
+}
+
+func (s *fileVolumeStore) Find(field, val string) (int, csi.VolumeInfo) {
+	s.Lock()
+	defer s.Unlock()
+	vols, err := s.load()
+	if err != nil {
+		return -1, csi.VolumeInfo{}
+	}
+	return findVol(vols, field, val)
+}
+
+func (s *fileVolumeStore) List() []csi.VolumeInfo {
+	s.Lock()
+	defer s.Unlock()
+	vols, err := s.load()
+	if err != nil {
+		return nil
+	}
+	return vols
+}
+
+func (s *fileVolumeStore) Put(v csi.VolumeInfo) {
+	s.Lock()
+	defer s.Unlock()
+	vols, err := s.load()
+	if err != nil {
+		return
+	}
+	vols = append(vols, v)
+	s.save(vols)
+}
+
+func (s *fileVolumeStore) Delete(id string) {
+	s.Lock()
+	defer s.Unlock()
+	vols, err := s.load()
+	if err != nil {
+		return
+	}
+	i, _ := findVol(vols, "id", id)
+	if i < 0 {
+		return
+	}
+	vols = append(vols[:i], vols[i+1:]...)
+	s.save(vols)
+}
+
+func (s *fileVolumeStore) Update(id string, fn func(v *csi.VolumeInfo)) bool {
+	s.Lock()
+	defer s.Unlock()
+	vols, err := s.load()
+	if err != nil {
+		return false
+	}
+	i, v := findVol(vols, "id", id)
+	if i < 0 {
+		return false
+	}
+	fn(&v)
+	vols[i] = v
+	return s.save(vols) == nil
+}
+
+// CachePersister is the narrow interface a durable key/value backend
+// (Etcd, Redis, ...) must satisfy to back a VolumeStore, matching the
+// pattern ceph-csi uses for its MetadataStore so consumers can plug in
+// their own persistence without the mock depending on any one of them.
+type CachePersister interface {
+	// Create persists data under identifier.
+	Create(identifier string, data interface{}) error
+	// Get loads the data stored under identifier into data.
+	Get(identifier string, data interface{}) error
+	// ForAll invokes f with the identifier of every stored entry whose
+	// key matches pattern.
+	ForAll(pattern string, data interface{}, f func(identifier string) error) error
+	// Delete removes the entry stored under identifier.
+	Delete(identifier string) error
+}
+
+// cachePersisterVolumeStore is a VolumeStore backed by a CachePersister,
+// letting a plugin author inject an Etcd- or Redis-backed implementation
+// while reusing the same VolumeStore contract the RPC handlers use.
+type cachePersisterVolumeStore struct {
+	cp CachePersister
+}
+
+// NewCachePersisterVolumeStore returns a VolumeStore backed by cp, with
+// one persisted entry per volume ID. Pass the result to WithVolumeStore
+// to have the mock service persist through cp (e.g. an Etcd- or
+// Redis-backed CachePersister) instead of the default in-memory store.
+func NewCachePersisterVolumeStore(cp CachePersister) VolumeStore {
+	return newCachePersisterVolumeStore(cp)
+}
+
+// newCachePersisterVolumeStore returns a VolumeStore backed by cp, with
+// one persisted entry per volume ID.
+func newCachePersisterVolumeStore(cp CachePersister) *cachePersisterVolumeStore {
+	return &cachePersisterVolumeStore{cp: cp}
+}
+
+func (s *cachePersisterVolumeStore) Get(id string) (csi.VolumeInfo, bool) {
+	var v csi.VolumeInfo
+	if err := s.cp.Get(id, &v); err != nil {
+		return csi.VolumeInfo{}, false
+	}
+	return v, true
+}
+
+func (s *cachePersisterVolumeStore) Find(field, val string) (int, csi.VolumeInfo) {
+	return findVol(s.List(), field, val)
+}
+
+func (s *cachePersisterVolumeStore) List() []csi.VolumeInfo {
+	var vols []csi.VolumeInfo
+	s.cp.ForAll("*", &csi.VolumeInfo{}, func(id string) error {
+		v, ok := s.Get(id)
+		if ok {
+			vols = append(vols, v)
+		}
+		return nil
+	})
+	return vols
+}
+
+func (s *cachePersisterVolumeStore) Put(v csi.VolumeInfo) {
+	s.cp.Create(v.Id, &v)
+}
+
+func (s *cachePersisterVolumeStore) Delete(id string) {
+	s.cp.Delete(id)
+}
+
+func (s *cachePersisterVolumeStore) Update(id string, fn func(v *csi.VolumeInfo)) bool {
+	v, ok := s.Get(id)
+	if !ok {
+		return false
+	}
+	fn(&v)
+	s.cp.Create(id, &v)
+	return true
+}
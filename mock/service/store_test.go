@@ -0,0 +1,41 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thecodeteam/gocsi/csi"
+)
+
+// TestFileVolumeStoreRoundTrip exercises the file-backed store's
+// deliverable: that volumes put through one store instance are still
+// there after the process restarts and a new instance is constructed
+// against the same file.
+func TestFileVolumeStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocsi-file-volume-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "volumes.json")
+
+	store1, err := NewFileVolumeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store1.Put(csi.VolumeInfo{Id: "1", Name: "vol1", CapacityBytes: gib100})
+
+	store2, err := NewFileVolumeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := store2.Get("1")
+	if !ok {
+		t.Fatal("expected volume 1 to survive reconstructing the store")
+	}
+	if v.Name != "vol1" {
+		t.Fatalf("got name %q, expected %q", v.Name, "vol1")
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/thecodeteam/gocsi/csi"
+)
+
+// topologyMatches returns true if every key/value pair in requisite is
+// present and equal in segments, i.e. segments satisfies requisite.
+func topologyMatches(segments, requisite map[string]string) bool {
+	for k, v := range requisite {
+		if segments[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// accessibleTopology picks the topology segments a newly created volume
+// should report, preferring the CO's preferred topology and otherwise
+// falling back to the first requisite segment.
+func accessibleTopology(
+	req *csi.AccessibilityRequirements) []*csi.Topology {
+
+	if req == nil {
+		return nil
+	}
+	if len(req.Preferred) > 0 {
+		return []*csi.Topology{req.Preferred[0]}
+	}
+	if len(req.Requisite) > 0 {
+		return []*csi.Topology{req.Requisite[0]}
+	}
+	return nil
+}
+
+// NodeGetInfo, like this service's expansion and snapshot RPCs, depends on a CSI
+// spec version this repo's vendored csi package does not pin (here,
+// NodeGetInfoRequest/Response, AccessibilityRequirements, csi.Topology,
+// and GetCapacityRequest.AccessibleTopology); that package isn't present
+// in this tree to regenerate, so the dependency is documented rather
+// than silently assumed. The envelope below is kept consistent with
+// every other RPC in this service (Reply/Result_), rather than mixing
+// in an unwrapped response shape.
+func (s *service) NodeGetInfo(
+	ctx context.Context,
+	req *csi.NodeGetInfoRequest) (
+	*csi.NodeGetInfoResponse, error) {
+
+	return &csi.NodeGetInfoResponse{
+		Reply: &csi.NodeGetInfoResponse_Result_{
+			Result: &csi.NodeGetInfoResponse_Result{
+				NodeId: s.nodeID,
+				AccessibleTopology: &csi.Topology{
+					Segments: s.nodeTopology,
+				},
+			},
+		},
+	}, nil
+}
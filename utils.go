@@ -0,0 +1,131 @@
+package gocsi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CSIEndpoint is the name of the environment variable that contains the
+// network address of the CSI endpoint, in the form "proto://addr". A
+// value with no "://" is treated as an implied "unix://" sock file.
+const CSIEndpoint = "CSI_ENDPOINT"
+
+var (
+	// ErrMissingCSIEndpoint occurs when the CSIEndpoint environment
+	// variable is not set or is empty.
+	ErrMissingCSIEndpoint = errors.New("missing CSI_ENDPOINT")
+
+	// ErrParseProtoAddrRequired occurs when ParseProtoAddr is given an
+	// empty (or all-whitespace) string.
+	ErrParseProtoAddrRequired = errors.New("required: proto://addr")
+)
+
+// csiNetworkFamilyRX matches the text preceding "://" in an endpoint
+// string that implies the endpoint names a network family, as opposed
+// to a file path that happens to contain "://" verbatim.
+var csiNetworkFamilyRX = regexp.MustCompile(`(?i)^(tcp|udp|unix|vsock)`)
+
+// csiValidNetworks enumerates the proto strings ParseProtoAddr accepts
+// once csiNetworkFamilyRX has decided an endpoint names a network
+// family.
+var csiValidNetworks = map[string]string{
+	"tcp": "tcp", "tcp4": "tcp4", "tcp6": "tcp6",
+	"udp": "udp", "udp4": "udp4", "udp6": "udp6",
+	"unix": "unix", "unixgram": "unixgram", "unixpacket": "unixpacket",
+	"vsock": "vsock",
+}
+
+// vsockCIDHost is the symbolic VMADDR_CID_HOST context ID, used by the
+// host side of a hypervisor to address itself over AF_VSOCK.
+const vsockCIDHost = 2
+
+// GetCSIEndpoint returns the CSI endpoint's protocol and address by
+// parsing the value of the CSIEndpoint environment variable.
+func GetCSIEndpoint() (proto string, addr string, err error) {
+	v := os.Getenv(CSIEndpoint)
+	if strings.TrimSpace(v) == "" {
+		return "", "", ErrMissingCSIEndpoint
+	}
+	return ParseProtoAddr(v)
+}
+
+// ParseProtoAddr parses a "proto://addr" endpoint string. A string with
+// no "://", or whose text before "://" does not resemble a known
+// network family, is treated as an implied unix sock file path.
+//
+// The vsock family additionally requires addr to be of the form
+// "<CID>:<port>", where CID may be the symbolic name "host", which maps
+// to VMADDR_CID_HOST -- this lets a plugin running inside a Kata,
+// Firecracker, or other hypervisor-backed sandbox be reached by the
+// host's node agent across the AF_VSOCK boundary without the caller
+// needing to know the host's numeric context ID.
+func ParseProtoAddr(protoAddr string) (proto string, addr string, err error) {
+	if strings.TrimSpace(protoAddr) == "" {
+		return "", "", ErrParseProtoAddrRequired
+	}
+
+	if !strings.Contains(protoAddr, "://") {
+		return "unix", protoAddr, nil
+	}
+
+	parts := strings.SplitN(protoAddr, "://", 2)
+	p, a := parts[0], parts[1]
+
+	if !csiNetworkFamilyRX.MatchString(p) {
+		// The text before "://" doesn't resemble a known network
+		// family, so treat the entire, original string as an implied
+		// sock file path rather than a malformed network address.
+		if _, operr := os.Open(protoAddr); operr != nil {
+			return "", "", fmt.Errorf(
+				"invalid implied sock file: %s: %v", protoAddr, operr)
+		}
+		return "unix", protoAddr, nil
+	}
+
+	network, ok := csiValidNetworks[strings.ToLower(p)]
+	if !ok {
+		return "", "", fmt.Errorf("invalid network address: %s", protoAddr)
+	}
+
+	if network == "vsock" {
+		if a, err = parseVsockAddr(a); err != nil {
+			return "", "", err
+		}
+	}
+
+	return network, a, nil
+}
+
+// parseVsockAddr validates and normalizes the addr portion of a
+// "vsock://" endpoint into a "CID:port" string, resolving the symbolic
+// CID "host" to VMADDR_CID_HOST.
+func parseVsockAddr(addr string) (string, error) {
+	parts := strings.SplitN(addr, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid vsock address: missing port: %s", addr)
+	}
+
+	cidPart, portPart := parts[0], parts[1]
+
+	var cid uint64
+	if strings.EqualFold(cidPart, "host") {
+		cid = vsockCIDHost
+	} else {
+		c, cerr := strconv.ParseUint(cidPart, 10, 32)
+		if cerr != nil {
+			return "", fmt.Errorf("invalid vsock address: malformed CID: %s", addr)
+		}
+		cid = c
+	}
+
+	port, perr := strconv.ParseUint(portPart, 10, 32)
+	if perr != nil {
+		return "", fmt.Errorf("invalid vsock address: malformed port: %s", addr)
+	}
+
+	return fmt.Sprintf("%d:%d", cid, port), nil
+}
@@ -3,6 +3,7 @@ package gocsi_test
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/thecodeteam/gocsi"
 )
@@ -39,6 +40,79 @@ var _ = Describe("ParseVersion", func() {
 			Ω(v.GetPatch()).Should(Equal(uint32(0)))
 		})
 	})
+	Context("1.2.0-rc.2", func() {
+		It("Should Parse", func() {
+			v := shouldParse()
+			Ω(v.GetMajor()).Should(Equal(uint32(1)))
+			Ω(v.GetMinor()).Should(Equal(uint32(2)))
+			Ω(v.GetPatch()).Should(Equal(uint32(0)))
+			Ω(v.GetPreRelease()).Should(Equal("rc.2"))
+			Ω(v.GetBuildMetadata()).Should(Equal(""))
+			Ω(v.String()).Should(Equal("1.2.0-rc.2"))
+		})
+	})
+	Context("1.2.0-rc.2+build.17", func() {
+		It("Should Parse", func() {
+			v := shouldParse()
+			Ω(v.GetMajor()).Should(Equal(uint32(1)))
+			Ω(v.GetMinor()).Should(Equal(uint32(2)))
+			Ω(v.GetPatch()).Should(Equal(uint32(0)))
+			Ω(v.GetPreRelease()).Should(Equal("rc.2"))
+			Ω(v.GetBuildMetadata()).Should(Equal("build.17"))
+			Ω(v.String()).Should(Equal("1.2.0-rc.2+build.17"))
+		})
+	})
+	Context("1.0.0-01", func() {
+		It("Should Not Parse", func() {
+			_, err := gocsi.ParseVersion(
+				CurrentGinkgoTestDescription().ComponentTexts[1])
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+	Context("1.0.0-rc.007", func() {
+		It("Should Not Parse", func() {
+			_, err := gocsi.ParseVersion(
+				CurrentGinkgoTestDescription().ComponentTexts[1])
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+	Context("1.0.0+build.007", func() {
+		It("Should Parse", func() {
+			v := shouldParse()
+			Ω(v.GetBuildMetadata()).Should(Equal("build.007"))
+		})
+	})
+})
+
+var _ = Describe("Version.Compare", func() {
+	It("Should Order Pre-Release Precedence", func() {
+		versions := []string{
+			"1.0.0-alpha",
+			"1.0.0-alpha.1",
+			"1.0.0-alpha.beta",
+			"1.0.0-beta",
+			"1.0.0-beta.2",
+			"1.0.0-beta.11",
+			"1.0.0-rc.1",
+			"1.0.0",
+		}
+		for i := 0; i < len(versions)-1; i++ {
+			lo, err := gocsi.ParseVersion(versions[i])
+			Ω(err).ShouldNot(HaveOccurred())
+			hi, err := gocsi.ParseVersion(versions[i+1])
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(gocsi.Compare(lo, hi)).Should(Equal(-1))
+			Ω(gocsi.Compare(hi, lo)).Should(Equal(1))
+			Ω(gocsi.Compare(lo, lo)).Should(Equal(0))
+		}
+	})
+	It("Should Ignore Build Metadata", func() {
+		a, err := gocsi.ParseVersion("1.0.0+build.1")
+		Ω(err).ShouldNot(HaveOccurred())
+		b, err := gocsi.ParseVersion("1.0.0+build.2")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(gocsi.Compare(a, b)).Should(Equal(0))
+	})
 })
 
 var _ = Describe("GetCSIEndpoint", func() {
@@ -121,6 +195,20 @@ var _ = Describe("GetCSIEndpoint", func() {
 			})
 			It("Should Be Valid", shouldBeValid)
 		})
+		Context("vsock://3:1024", func() {
+			BeforeEach(func() {
+				expProto = "vsock"
+				expAddr = "3:1024"
+			})
+			It("Should Be Valid", shouldBeValid)
+		})
+		Context("vsock://host:1024", func() {
+			BeforeEach(func() {
+				expProto = "vsock"
+				expAddr = "2:1024"
+			})
+			It("Should Be Valid", shouldBeValid)
+		})
 	})
 
 	Context("Missing Endpoint", func() {
@@ -167,6 +255,29 @@ var _ = Describe("GetCSIEndpoint", func() {
 			It("Should Be An Invalid Implied Sock File", shouldBeInvalid)
 		})
 	})
+
+	Context("Invalid Vsock Address", func() {
+		shouldBeInvalid := func(reason string) func() {
+			return func() {
+				Ω(err).Should(HaveOccurred())
+				Ω(err.Error()).Should(Equal(fmt.Sprintf(
+					"invalid vsock address: %s: %s", reason,
+					strings.TrimPrefix(expEndpoint, "vsock://"))))
+			}
+		}
+		Context("vsock://x:1024", func() {
+			It("Should Be An Invalid CID", shouldBeInvalid("malformed CID"))
+		})
+		Context("vsock://3", func() {
+			It("Should Be Missing A Port", shouldBeInvalid("missing port"))
+		})
+		Context("vsock://3:", func() {
+			It("Should Be Missing A Port", shouldBeInvalid("missing port"))
+		})
+		Context("vsock://3:x", func() {
+			It("Should Be An Invalid Port", shouldBeInvalid("malformed port"))
+		})
+	})
 })
 
 var _ = Describe("ParseProtoAddr", func() {
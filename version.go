@@ -0,0 +1,194 @@
+package gocsi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version describes a SemVer 2.0 version number -- MAJOR.MINOR.PATCH,
+// optionally followed by a "-" pre-release suffix and/or a "+" build
+// metadata suffix -- per https://semver.org.
+type Version struct {
+	major, minor, patch uint32
+	preRelease          string
+	buildMetadata       string
+}
+
+// GetMajor returns v's MAJOR version component.
+func (v Version) GetMajor() uint32 { return v.major }
+
+// GetMinor returns v's MINOR version component.
+func (v Version) GetMinor() uint32 { return v.minor }
+
+// GetPatch returns v's PATCH version component.
+func (v Version) GetPatch() uint32 { return v.patch }
+
+// GetPreRelease returns v's pre-release identifiers, joined with ".",
+// or an empty string if v has none.
+func (v Version) GetPreRelease() string { return v.preRelease }
+
+// GetBuildMetadata returns v's build metadata identifiers, joined with
+// ".", or an empty string if v has none.
+func (v Version) GetBuildMetadata() string { return v.buildMetadata }
+
+// String renders v back into its canonical SemVer 2.0 text form, such
+// that ParseVersion(v.String()) always yields v back.
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.preRelease != "" {
+		s += "-" + v.preRelease
+	}
+	if v.buildMetadata != "" {
+		s += "+" + v.buildMetadata
+	}
+	return s
+}
+
+// semverIdentifier matches a single dot-separated pre-release or build
+// identifier: digits, letters, and hyphens.
+const semverIdentifier = `[0-9A-Za-z-]+`
+
+// semverPreReleaseIdentifier matches a single dot-separated pre-release
+// identifier. It differs from semverIdentifier by forbidding a purely
+// numeric identifier with a leading zero (e.g. "01"), since SemVer 2.0
+// requires numeric pre-release identifiers to have no leading zeros;
+// build metadata identifiers, which still use semverIdentifier, carry
+// no such restriction.
+const semverPreReleaseIdentifier = `(?:0|[1-9]\d*|\d*[A-Za-z-][0-9A-Za-z-]*)`
+
+// semverRX parses a SemVer 2.0 string into its five components: major,
+// minor, patch, pre-release (without its leading "-"), and build
+// metadata (without its leading "+").
+var semverRX = regexp.MustCompile(
+	`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(?:-(` + semverPreReleaseIdentifier + `(?:\.` + semverPreReleaseIdentifier + `)*))?` +
+		`(?:\+(` + semverIdentifier + `(?:\.` + semverIdentifier + `)*))?$`)
+
+// numericIdentifierRX matches a pre-release identifier that should be
+// compared as a number rather than a string, per the SemVer 2.0
+// precedence rules.
+var numericIdentifierRX = regexp.MustCompile(`^[0-9]+$`)
+
+// ParseVersion parses s as a SemVer 2.0 version string.
+func ParseVersion(s string) (Version, error) {
+	m := semverRX.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version: %s", s)
+	}
+
+	major, _ := strconv.ParseUint(m[1], 10, 32)
+	minor, _ := strconv.ParseUint(m[2], 10, 32)
+	patch, _ := strconv.ParseUint(m[3], 10, 32)
+
+	return Version{
+		major:         uint32(major),
+		minor:         uint32(minor),
+		patch:         uint32(patch),
+		preRelease:    m[4],
+		buildMetadata: m[5],
+	}, nil
+}
+
+// Compare returns -1, 0, or 1 as a's precedence is lower than, equal
+// to, or higher than b's, per the SemVer 2.0 precedence rules: MAJOR,
+// MINOR, and PATCH are compared numerically; a version with a
+// pre-release has lower precedence than one without; otherwise
+// pre-release identifiers are compared left to right, with numeric
+// identifiers compared numerically, alphanumeric identifiers compared
+// lexically, numeric identifiers always lower than alphanumeric ones,
+// and a shorter identifier list lower than a longer one that otherwise
+// shares the same prefix. Build metadata is ignored.
+func Compare(a, b Version) int {
+	if d := compareUint32(a.major, b.major); d != 0 {
+		return d
+	}
+	if d := compareUint32(a.minor, b.minor); d != 0 {
+		return d
+	}
+	if d := compareUint32(a.patch, b.patch); d != 0 {
+		return d
+	}
+
+	switch {
+	case a.preRelease == "" && b.preRelease == "":
+		return 0
+	case a.preRelease == "":
+		return 1
+	case b.preRelease == "":
+		return -1
+	}
+
+	aIDs := strings.Split(a.preRelease, ".")
+	bIDs := strings.Split(b.preRelease, ".")
+
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if d := compareIdentifier(aIDs[i], bIDs[i]); d != 0 {
+			return d
+		}
+	}
+	return compareInt(len(aIDs), len(bIDs))
+}
+
+// compareIdentifier compares a single pair of pre-release identifiers
+// per the SemVer 2.0 rules described on Compare.
+func compareIdentifier(a, b string) int {
+	aNum, aIsNum := parseNumericIdentifier(a)
+	bNum, bIsNum := parseNumericIdentifier(b)
+
+	switch {
+	case aIsNum && bIsNum:
+		return compareUint64(aNum, bNum)
+	case aIsNum && !bIsNum:
+		return -1
+	case !aIsNum && bIsNum:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func parseNumericIdentifier(s string) (uint64, bool) {
+	if !numericIdentifierRX.MatchString(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func compareUint32(a, b uint32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,75 @@
+package gocsi
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// volumeLocksPollInterval is how often TryAcquireContext re-checks a
+// contended key while waiting for it to free up or for ctx to be done.
+const volumeLocksPollInterval = 50 * time.Millisecond
+
+// VolumeLocks provides non-blocking, per-key locking modeled on ceph-csi's
+// util.VolumeLocks. Unlike a map of mutexes that grows forever as new keys
+// are seen, a VolumeLocks entry only exists for the duration an operation
+// holds it, so memory stays bounded to the set of concurrently in-flight
+// operations. A plugin's controller and node servers can use VolumeLocks
+// to get the same locking primitive this package's idempotent interceptor
+// uses; the interceptor's own VolumeLocks instances are internal to it
+// and are not shared with callers.
+type VolumeLocks struct {
+	locksL sync.Mutex
+	locks  map[string]struct{}
+}
+
+// NewVolumeLocks returns a new, empty VolumeLocks.
+func NewVolumeLocks() *VolumeLocks {
+	return &VolumeLocks{locks: map[string]struct{}{}}
+}
+
+// TryAcquire attempts to lock the provided key, returning true if the
+// lock was acquired. It returns false immediately, without blocking, if
+// an operation is already in flight for the same key.
+func (v *VolumeLocks) TryAcquire(key string) bool {
+	v.locksL.Lock()
+	defer v.locksL.Unlock()
+	if _, ok := v.locks[key]; ok {
+		return false
+	}
+	v.locks[key] = struct{}{}
+	return true
+}
+
+// Release releases the lock held for the provided key.
+func (v *VolumeLocks) Release(key string) {
+	v.locksL.Lock()
+	defer v.locksL.Unlock()
+	delete(v.locks, key)
+}
+
+// TryAcquireContext attempts to lock the provided key, polling until
+// either the lock is acquired or ctx is done, whichever happens first.
+// It returns false without acquiring the lock if ctx is done. Callers
+// that want TryAcquire's immediate, non-blocking behavior should pass a
+// ctx that is already done, or use TryAcquire directly.
+func (v *VolumeLocks) TryAcquireContext(ctx context.Context, key string) bool {
+	if v.TryAcquire(key) {
+		return true
+	}
+
+	t := time.NewTicker(volumeLocksPollInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C:
+			if v.TryAcquire(key) {
+				return true
+			}
+		}
+	}
+}